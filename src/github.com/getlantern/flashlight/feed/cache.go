@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/getlantern/appdir"
+)
+
+// cacheEntry records the validators returned by the last successful fetch
+// of a given feedURL so the next request can be sent as a conditional GET.
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+var (
+	cacheMu    sync.Mutex
+	cacheByURL map[string]*cacheEntry
+)
+
+// cacheFilePath is where the feed validator cache lives on disk. It's a
+// single JSON file keyed by resolved feedURL so per-locale entries (and
+// any user-added feeds) coexist without clobbering each other.
+func cacheFilePath() string {
+	return filepath.Join(appdir.General("Lantern"), "feedcache.json")
+}
+
+// loadCacheLocked lazily reads the on-disk cache into memory the first
+// time it's needed. Callers must hold cacheMu.
+func loadCacheLocked() map[string]*cacheEntry {
+	if cacheByURL != nil {
+		return cacheByURL
+	}
+
+	cacheByURL = make(map[string]*cacheEntry)
+	b, err := ioutil.ReadFile(cacheFilePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debugf("Error reading feed cache: %v", err)
+		}
+		return cacheByURL
+	}
+	if err := json.Unmarshal(b, &cacheByURL); err != nil {
+		log.Debugf("Error parsing feed cache, starting fresh: %v", err)
+		cacheByURL = make(map[string]*cacheEntry)
+	}
+	return cacheByURL
+}
+
+// cacheEntryFor returns the cached validators for feedURL, or nil if
+// we've never successfully fetched it before.
+func cacheEntryFor(feedURL string) *cacheEntry {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	return loadCacheLocked()[feedURL]
+}
+
+// saveCacheEntry persists the validators for feedURL so the next fetch
+// can be conditional.
+func saveCacheEntry(feedURL string, entry *cacheEntry) {
+	cacheMu.Lock()
+	cache := loadCacheLocked()
+	cache[feedURL] = entry
+	b, err := json.Marshal(cache)
+	cacheMu.Unlock()
+	if err != nil {
+		log.Debugf("Error marshaling feed cache: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(cacheFilePath(), b, 0644); err != nil {
+		log.Debugf("Error writing feed cache: %v", err)
+	}
+}
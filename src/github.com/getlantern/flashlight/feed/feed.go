@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/getlantern/eventual"
@@ -24,6 +25,11 @@ const (
 
 var (
 	feed *Feed
+	// feedMu guards feed, userSources, and userItems, all of which the
+	// Scheduler's worker pool can touch from multiple goroutines at
+	// once: the curated aggregator job rebuilds feed from scratch while
+	// user-feed jobs merge into it concurrently.
+	feedMu sync.Mutex
 	// locales we have separate feeds available for
 	supportedLocales = map[string]bool{
 		"en_US": true,
@@ -53,6 +59,18 @@ type Source struct {
 	Url            string `json:"link"`
 	ExcludeFromAll bool   `json:"excludeFromAll"`
 	Entries        []int  `json:"entries"`
+
+	// Successes, Failures, and NextAttempt are maintained by the
+	// Scheduler so a chronically dead feed backs off exponentially
+	// instead of starving healthy ones.
+	Successes   int       `json:"-"`
+	Failures    int       `json:"-"`
+	NextAttempt time.Time `json:"-"`
+
+	// Category is the OPML outline group a source was imported under,
+	// if any. ExportOPML uses it to nest a source back under the same
+	// group instead of flattening every subscription.
+	Category string `json:"-"`
 }
 
 type FeedItem struct {
@@ -64,6 +82,13 @@ type FeedItem struct {
 	Content     string `json:"contentSnippetText"`
 	Source      string `json:"source"`
 	Description string `json:"-"`
+
+	// FullHTML, Images, WordCount, and LinkCount are only populated
+	// after a successful call to Fulldoc.
+	FullHTML  string   `json:"fullHtml,omitempty"`
+	Images    []string `json:"images,omitempty"`
+	WordCount int      `json:"wordCount,omitempty"`
+	LinkCount int      `json:"linkCount,omitempty"`
 }
 
 type FeedItems []*FeedItem
@@ -81,6 +106,8 @@ type FeedRetriever interface {
 // FeedByName checks the previously created feed for an
 // entry with the given source name
 func FeedByName(name string, retriever FeedRetriever) {
+	feedMu.Lock()
+	defer feedMu.Unlock()
 	if feed != nil && feed.Items != nil {
 		if items, exists := feed.Items[name]; exists {
 			for _, i := range items {
@@ -94,39 +121,65 @@ func FeedByName(name string, retriever FeedRetriever) {
 // NumFeedEntries just returns the total number of entries
 // across all feeds
 func NumFeedEntries() int {
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	if feed == nil {
+		return 0
+	}
 	count := len(feed.Entries)
 	log.Debugf("Number of feed entries: %d", count)
 	return count
 }
 
 func CurrentFeed() *Feed {
+	feedMu.Lock()
+	defer feedMu.Unlock()
 	return feed
 }
 
+// haveFeed reports whether a feed is currently held in memory.
+func haveFeed() bool {
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	return feed != nil
+}
+
 func handleError(err error) {
+	feedMu.Lock()
 	feed = nil
+	feedMu.Unlock()
 	log.Error(err)
 }
 
-// GetFeed creates an http.Client and fetches the latest
-// Lantern public feed for displaying on the home screen.
-// If a proxyAddr is specified, the http.Client will proxy
-// through it
+// GetFeed enqueues a fetch of the curated Lantern feed, plus a fetch of
+// every user-added feed, on the package Scheduler's worker pool and
+// blocks until that first batch completes. StartTicker runs the same
+// batch on an interval; RefreshFeed re-fetches only the curated feed, and
+// does so directly rather than through the Scheduler, so the Scheduler's
+// per-host politeness and backoff don't apply to it.
 func GetFeed(locale string, allStr string, proxyAddr string,
+	provider FeedProvider) {
+	defaultScheduler().fetchAll(locale, allStr, proxyAddr, provider)
+}
+
+// RefreshFeed re-fetches the curated Lantern feed using the same
+// conditional GET semantics as GetFeed. It's cheap enough for a
+// background scheduler to call on a regular ticker, since a feed that
+// hasn't changed since the last fetch costs a 304 rather than a full
+// re-download.
+func RefreshFeed(locale string, allStr string, proxyAddr string,
 	provider FeedProvider) {
 	doGetFeed(defaultFeedEndpoint, locale, allStr, proxyAddr, provider)
 }
 
 func doGetFeed(feedEndpoint string, locale string, allStr string,
-	proxyAddr string, provider FeedProvider) {
+	proxyAddr string, provider FeedProvider) error {
 
 	var err error
 	var req *http.Request
 	var res *http.Response
 	var httpClient *http.Client
 
-	feed = &Feed{}
-
 	if !supportedLocales[locale] {
 		// always default to English if we don't
 		// have a feed available in a specific locale
@@ -136,54 +189,108 @@ func doGetFeed(feedEndpoint string, locale string, allStr string,
 	feedURL := getFeedURL(feedEndpoint, locale)
 
 	if req, err = http.NewRequest("GET", feedURL, nil); err != nil {
-		handleError(fmt.Errorf("Error fetching feed: %v", err))
-		return
+		err = fmt.Errorf("Error fetching feed: %v", err)
+		handleError(err)
+		return err
 	}
 
 	// ask for gzipped feed content
 	req.Header.Add("Accept-Encoding", "gzip")
 
-	if proxyAddr == "" {
-		httpClient = &http.Client{}
-	} else {
-		httpClient, err = util.HTTPClient("", eventual.DefaultGetter(proxyAddr))
-		if err != nil {
-			handleError(fmt.Errorf("Error creating client: %v", err))
-			return
+	// Send back whatever validators we saved from the last successful
+	// fetch of this feedURL so the server can answer with a cheap 304 if
+	// nothing has changed. Only do this if we actually still have that
+	// feed in memory to reuse: the validator cache survives a process
+	// restart on disk, but `feed` doesn't, so honoring a 304 against a
+	// validator left over from a previous run would mean reusing a feed
+	// we don't have.
+	if cached := cacheEntryFor(feedURL); cached != nil && haveFeed() {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
 		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	if httpClient, err = newHTTPClient(proxyAddr); err != nil {
+		err = fmt.Errorf("Error creating client: %v", err)
+		handleError(err)
+		return err
 	}
 
 	if res, err = httpClient.Do(req); err != nil {
-		handleError(fmt.Errorf("Error fetching feed: %v", err))
-		return
+		err = fmt.Errorf("Error fetching feed: %v", err)
+		handleError(err)
+		return err
 	}
 
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotModified {
+		// nothing changed since our last fetch; keep serving the feed
+		// we already have in memory instead of clearing it out
+		log.Debugf("Feed not modified, reusing cached copy: %v", feedURL)
+		return nil
+	}
+
+	// parse into a local Feed first; the in-memory `feed` global isn't
+	// touched until we're ready to swap it in under feedMu, so a
+	// concurrently-running user-feed merge never sees a half-built Feed
+	newFeed := &Feed{}
+
 	gzReader, err := gzip.NewReader(res.Body)
 	if err != nil {
-		handleError(fmt.Errorf("Unable to open gzip reader: %s", err))
-		return
+		err = fmt.Errorf("Unable to open gzip reader: %s", err)
+		handleError(err)
+		return err
 	}
 
 	contents, err := ioutil.ReadAll(gzReader)
 	if err != nil {
-		handleError(fmt.Errorf("Error reading feed: %v", err))
-		return
+		err = fmt.Errorf("Error reading feed: %v", err)
+		handleError(err)
+		return err
 	}
 
-	err = json.Unmarshal(contents, feed)
+	err = json.Unmarshal(contents, newFeed)
 	if err != nil {
-		handleError(fmt.Errorf("Error parsing feed: %v", err))
-		return
+		err = fmt.Errorf("Error parsing feed: %v", err)
+		handleError(err)
+		return err
 	}
 
-	processFeed(allStr, provider)
+	saveCacheEntry(feedURL, &cacheEntry{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	})
+
+	feedMu.Lock()
+	feed = newFeed
+	sourceTitles := processFeed(allStr)
+	// the aggregator just replaced `feed` wholesale, so restore whatever
+	// user feeds had merged into the previous one instead of silently
+	// dropping them until their own next refresh
+	reapplyUserFeedsLocked(allStr)
+	feedMu.Unlock()
+
+	// provider.AddSource is caller code we don't control, and it's known
+	// to re-enter exported functions like CurrentFeed that also take
+	// feedMu, so it must run after the lock is released, the same way
+	// AddUserFeed defers its own AddSource call until after unlocking.
+	for _, title := range sourceTitles {
+		provider.AddSource(title)
+	}
+	return nil
 }
 
-// processFeed is used after a feed has been downloaded
-// to extract feed sources and items for processing.
-func processFeed(allStr string, provider FeedProvider) {
+// processFeed is used after a feed has been downloaded to extract feed
+// sources and items for processing. It returns the titles of every
+// source to report to the FeedProvider; callers must report them via
+// provider.AddSource themselves, after releasing feedMu, since the
+// provider is caller code that may re-enter other exported functions in
+// this package. Callers must hold feedMu.
+func processFeed(allStr string) []string {
 
 	log.Debugf("Num of Feed Entries: %v", len(feed.Entries))
 
@@ -202,22 +309,34 @@ func processFeed(allStr string, provider FeedProvider) {
 		feed.Entries[i].Description = desc
 	}
 
+	// s.Entries below indexes into the feed as originally downloaded, so
+	// hang on to that slice before any registered Filter prunes
+	// feed.Entries down to what's actually kept.
+	downloaded := feed.Entries
+
 	// the 'all' tab contains every article that's not associated with an
-	// excluded feed.
-	all := make(FeedItems, 0, len(feed.Entries))
-	for _, entry := range feed.Entries {
+	// excluded feed and that every registered Filter agrees to keep.
+	all := make(FeedItems, 0, len(downloaded))
+	kept := make(FeedItems, 0, len(downloaded))
+	for _, entry := range downloaded {
+		if !keepItem(entry) {
+			continue
+		}
+		kept = append(kept, entry)
 		if !feed.Feeds[entry.Source].ExcludeFromAll {
 			all = append(all, entry)
 		}
 	}
+	feed.Entries = kept
 	feed.Items[allStr] = all
 
-	// Get a list of feed sources and send those back to the UI
+	// Get a list of feed sources to report back to the UI
+	var sourceTitles []string
 	for _, source := range feed.Sorted {
 		if entry, exists := feed.Feeds[source]; exists {
 			if entry.Title != "" {
 				log.Debugf("Adding feed source: %s", entry.Title)
-				provider.AddSource(entry.Title)
+				sourceTitles = append(sourceTitles, entry.Title)
 			} else {
 				log.Errorf("Skipping feed source: %s; missing title", source)
 			}
@@ -228,12 +347,26 @@ func processFeed(allStr string, provider FeedProvider) {
 
 	for _, s := range feed.Feeds {
 		for _, i := range s.Entries {
-			entry := feed.Entries[i]
+			entry := downloaded[i]
+			if !keepItem(entry) {
+				continue
+			}
 			// every feed item gets appended to a feed source array
 			// for quick reference
 			feed.Items[s.Title] = append(feed.Items[s.Title], entry)
 		}
 	}
+
+	return sourceTitles
+}
+
+// newHTTPClient builds an http.Client, proxying through proxyAddr when
+// one is specified.
+func newHTTPClient(proxyAddr string) (*http.Client, error) {
+	if proxyAddr == "" {
+		return &http.Client{}, nil
+	}
+	return util.HTTPClient("", eventual.DefaultGetter(proxyAddr))
 }
 
 // GetFeedURL returns the URL to use for looking up the feed by looking up
@@ -0,0 +1,239 @@
+package feed
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filter decides whether a FeedItem should survive processFeed. Keep is
+// called on each entry as processFeed builds feed.Entries and again as it
+// fills each source's bucket (and on each user-feed item as it's
+// merged), so operators
+// shipping Lantern to a specific region can suppress items that are
+// irrelevant or unsafe to display there. A filtered-out entry is removed
+// from feed.Entries and from every feed.Items bucket it would otherwise
+// have appeared in, so NumFeedEntries stays consistent with what the UI
+// actually shows.
+type Filter interface {
+	Keep(item *FeedItem) bool
+}
+
+var (
+	filtersMu sync.Mutex
+	filters   = make(map[string]Filter)
+)
+
+// RegisterFilter installs a named Filter that processFeed applies to
+// every entry on subsequent fetches. Downstream Lantern builds (Android,
+// desktop) use this to inject their own Go filters without forking the
+// feed package. Registering under a name already in use replaces it.
+func RegisterFilter(name string, f Filter) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	filters[name] = f
+}
+
+// UnregisterFilter removes a previously registered Filter, if any.
+func UnregisterFilter(name string) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	delete(filters, name)
+}
+
+func keepItem(item *FeedItem) bool {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	for _, f := range filters {
+		if !f.Keep(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldValue(item *FeedItem, field string) string {
+	switch field {
+	case "content":
+		return item.Content
+	case "source":
+		return item.Source
+	default:
+		return item.Title
+	}
+}
+
+// RegexFilter keeps only entries whose field ("title", "content", or
+// "source") matches Pattern, or fails to match it when Exclude is set.
+type RegexFilter struct {
+	Field   string
+	Pattern *regexp.Regexp
+	Exclude bool
+}
+
+// Keep implements Filter.
+func (f *RegexFilter) Keep(item *FeedItem) bool {
+	matched := f.Pattern.MatchString(fieldValue(item, f.Field))
+	if f.Exclude {
+		return !matched
+	}
+	return matched
+}
+
+// SourceListFilter keeps or rejects entries based on an allow or deny
+// list of source names.
+type SourceListFilter struct {
+	Sources map[string]bool
+	// Allow makes Sources an allow list; otherwise it's a deny list.
+	Allow bool
+}
+
+// Keep implements Filter.
+func (f *SourceListFilter) Keep(item *FeedItem) bool {
+	listed := f.Sources[item.Source]
+	if f.Allow {
+		return listed
+	}
+	return !listed
+}
+
+// MaxAgeFilter keeps only entries published within Max of now. It reads
+// the "pubDate" field that the upstream feed surfaces on FeedItem.Meta,
+// and keeps entries whose publish date it can't determine.
+type MaxAgeFilter struct {
+	Max time.Duration
+}
+
+// Keep implements Filter.
+func (f *MaxAgeFilter) Keep(item *FeedItem) bool {
+	raw, ok := item.Meta["pubDate"]
+	if !ok {
+		return true
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return true
+	}
+	t, err := time.Parse(time.RFC1123Z, s)
+	if err != nil {
+		return true
+	}
+	return time.Since(t) <= f.Max
+}
+
+// ExprFilter evaluates a small expression language over a FeedItem, e.g.
+// `title ~ /breaking/i && source != "reddit"`. An expression is a
+// &&-separated list of terms `field op value`, where field is one of
+// title/content/source, op is ~ or !~ for a regex match/non-match
+// (/pattern/i for case-insensitive) and == or != for an exact string
+// comparison.
+type ExprFilter struct {
+	terms []exprTerm
+}
+
+type exprTerm struct {
+	field string
+	op    string
+	re    *regexp.Regexp
+	value string
+}
+
+// NewExprFilter compiles expr into an ExprFilter.
+func NewExprFilter(expr string) (*ExprFilter, error) {
+	var terms []exprTerm
+	for _, part := range strings.Split(expr, "&&") {
+		term, err := parseExprTerm(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return &ExprFilter{terms: terms}, nil
+}
+
+func parseExprTerm(part string) (exprTerm, error) {
+	for _, op := range []string{"!~", "~", "!=", "=="} {
+		idx := indexOutsideQuotes(part, op)
+		if idx < 0 {
+			continue
+		}
+		field := strings.TrimSpace(part[:idx])
+		value := strings.TrimSpace(part[idx+len(op):])
+		term := exprTerm{field: field, op: op}
+		if op == "~" || op == "!~" {
+			re, err := parseRegexLiteral(value)
+			if err != nil {
+				return exprTerm{}, err
+			}
+			term.re = re
+		} else {
+			term.value = strings.Trim(value, `"`)
+		}
+		return term, nil
+	}
+	return exprTerm{}, fmt.Errorf("feed: invalid filter expression term %q", part)
+}
+
+// indexOutsideQuotes returns the index of the first occurrence of op in
+// part that isn't inside a double-quoted string literal, or -1 if there
+// is none, so an operator character that appears inside a quoted
+// comparison value (e.g. `source == "a!=b"`) doesn't get mistaken for
+// the term's actual operator.
+func indexOutsideQuotes(part, op string) int {
+	inQuotes := false
+	for i := 0; i+len(op) <= len(part); i++ {
+		if part[i] == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if !inQuotes && part[i:i+len(op)] == op {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseRegexLiteral parses a /pattern/flags literal. The only flag
+// understood is "i" for case-insensitive matching.
+func parseRegexLiteral(lit string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(lit, "/") {
+		return nil, fmt.Errorf("feed: invalid regex literal %q", lit)
+	}
+	end := strings.LastIndex(lit, "/")
+	if end <= 0 {
+		return nil, fmt.Errorf("feed: invalid regex literal %q", lit)
+	}
+	pattern, flags := lit[1:end], lit[end+1:]
+	if strings.Contains(flags, "i") {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// Keep implements Filter.
+func (f *ExprFilter) Keep(item *FeedItem) bool {
+	for _, t := range f.terms {
+		if !t.matches(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t exprTerm) matches(item *FeedItem) bool {
+	val := fieldValue(item, t.field)
+	switch t.op {
+	case "~":
+		return t.re.MatchString(val)
+	case "!~":
+		return !t.re.MatchString(val)
+	case "==":
+		return val == t.value
+	case "!=":
+		return val != t.value
+	default:
+		return true
+	}
+}
@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExprFilterKeep(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		item *FeedItem
+		want bool
+	}{
+		{
+			name: "regex match on title",
+			expr: `title ~ /breaking/i`,
+			item: &FeedItem{Title: "BREAKING: something happened"},
+			want: true,
+		},
+		{
+			name: "regex non-match on title",
+			expr: `title ~ /breaking/i`,
+			item: &FeedItem{Title: "a calm day"},
+			want: false,
+		},
+		{
+			name: "negated regex",
+			expr: `title !~ /breaking/i`,
+			item: &FeedItem{Title: "a calm day"},
+			want: true,
+		},
+		{
+			name: "exact source mismatch excludes",
+			expr: `source != "reddit"`,
+			item: &FeedItem{Source: "reddit"},
+			want: false,
+		},
+		{
+			name: "exact source match keeps",
+			expr: `source == "reddit"`,
+			item: &FeedItem{Source: "reddit"},
+			want: true,
+		},
+		{
+			name: "combined terms all must match",
+			expr: `title ~ /breaking/i && source != "reddit"`,
+			item: &FeedItem{Title: "BREAKING news", Source: "reddit"},
+			want: false,
+		},
+		{
+			name: "operator characters inside a quoted value don't split the term",
+			expr: `source == "a!=b"`,
+			item: &FeedItem{Source: "a!=b"},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewExprFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("NewExprFilter(%q) returned error: %v", tt.expr, err)
+			}
+			if got := f.Keep(tt.item); got != tt.want {
+				t.Errorf("Keep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewExprFilterInvalid(t *testing.T) {
+	if _, err := NewExprFilter("title"); err == nil {
+		t.Error("expected an error for a term with no operator, got nil")
+	}
+	if _, err := NewExprFilter(`title ~ breaking`); err == nil {
+		t.Error("expected an error for a regex literal missing its slashes, got nil")
+	}
+}
+
+func TestKeepItemRunsAllRegisteredFilters(t *testing.T) {
+	defer func() {
+		UnregisterFilter("test-allow")
+		UnregisterFilter("test-deny")
+	}()
+
+	RegisterFilter("test-allow", &SourceListFilter{Sources: map[string]bool{"nyt": true}, Allow: true})
+	RegisterFilter("test-deny", &RegexFilter{Field: "title", Pattern: regexp.MustCompile("spam"), Exclude: true})
+
+	if !keepItem(&FeedItem{Source: "nyt", Title: "real news"}) {
+		t.Error("expected item from an allowed source with no matching deny pattern to be kept")
+	}
+	if keepItem(&FeedItem{Source: "nyt", Title: "this is spam"}) {
+		t.Error("expected item matching the deny filter to be dropped even though the allow filter kept it")
+	}
+	if keepItem(&FeedItem{Source: "other", Title: "real news"}) {
+		t.Error("expected item from a non-allowed source to be dropped")
+	}
+}
@@ -0,0 +1,182 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline,omitempty"`
+}
+
+// ImportOPML parses an OPML subscription list, registers the feed
+// Sources it describes as user feeds, and returns them, so a user
+// migrating from another reader (or between Lantern installs) can bring
+// their subscriptions with them. Nested <outline> elements without an
+// xmlUrl are treated as category groups; xmlUrl is the feed URL, with
+// htmlUrl and text/title used as display metadata when a feed outline
+// has no title of its own. Sources already registered, either as a
+// curated Lantern feed or a previously added user feed, are skipped.
+// Registering them in userSources means the Scheduler picks each one up
+// on its next refresh cycle the same way AddUserFeed's sources are; the
+// returned Sources won't have any Entries until that first refresh
+// completes.
+func ImportOPML(r io.Reader) ([]*Source, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Error parsing OPML: %v", err)
+	}
+
+	var sources []*Source
+	var walk func(outlines []opmlOutline, category string)
+	walk = func(outlines []opmlOutline, category string) {
+		for _, o := range outlines {
+			if o.XMLURL == "" {
+				group := o.Title
+				if group == "" {
+					group = o.Text
+				}
+				walk(o.Outlines, group)
+				continue
+			}
+			if isRegisteredFeed(o.XMLURL) {
+				continue
+			}
+			title := o.Title
+			if title == "" {
+				title = o.Text
+			}
+			if title == "" {
+				title = o.HTMLURL
+			}
+			sources = append(sources, &Source{
+				FeedUrl:  o.XMLURL,
+				Title:    title,
+				Url:      o.HTMLURL,
+				Category: category,
+			})
+		}
+	}
+	walk(doc.Body.Outlines, "")
+
+	feedMu.Lock()
+	for _, source := range sources {
+		userSources[source.FeedUrl] = source
+	}
+	feedMu.Unlock()
+
+	return sources, nil
+}
+
+func isRegisteredFeed(feedURL string) bool {
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	if _, exists := userSources[feedURL]; exists {
+		return true
+	}
+	if feed != nil {
+		for _, s := range feed.Feeds {
+			if s.FeedUrl == feedURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ExportOPML writes the current subscriptions as OPML 2.0: the curated
+// Lantern feeds grouped under a "Lantern" outline, any user-added feeds
+// under "Subscriptions", and within each, sources that carry a Category
+// (typically set by a prior ImportOPML) nested under their own group
+// rather than flattened.
+func ExportOPML(w io.Writer) error {
+	doc := opmlDocument{Version: "2.0", Head: opmlHead{Title: "Lantern Subscriptions"}}
+
+	if lantern := groupOutlines(curatedSources()); len(lantern) > 0 {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{Text: "Lantern", Outlines: lantern})
+	}
+
+	var subscriptions []*Source
+	for _, s := range snapshotUserSources() {
+		subscriptions = append(subscriptions, s)
+	}
+	if subs := groupOutlines(subscriptions); len(subs) > 0 {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{Text: "Subscriptions", Outlines: subs})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+func curatedSources() []*Source {
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	if feed == nil {
+		return nil
+	}
+	var sources []*Source
+	for _, s := range feed.Feeds {
+		if _, isUser := userSources[s.FeedUrl]; !isUser {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+// groupOutlines nests each source under a sub-outline named after its
+// Category, leaving uncategorized sources at the top level.
+func groupOutlines(sources []*Source) []opmlOutline {
+	var top []opmlOutline
+	groups := make(map[string][]opmlOutline)
+	var order []string
+
+	for _, s := range sources {
+		o := sourceOutline(s)
+		if s.Category == "" {
+			top = append(top, o)
+			continue
+		}
+		if _, exists := groups[s.Category]; !exists {
+			order = append(order, s.Category)
+		}
+		groups[s.Category] = append(groups[s.Category], o)
+	}
+
+	for _, category := range order {
+		top = append(top, opmlOutline{Text: category, Outlines: groups[category]})
+	}
+	return top
+}
+
+func sourceOutline(s *Source) opmlOutline {
+	return opmlOutline{
+		Text:    s.Title,
+		Title:   s.Title,
+		XMLURL:  s.FeedUrl,
+		HTMLURL: s.Url,
+	}
+}
@@ -0,0 +1,118 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+)
+
+// resetFeedState clears the package globals ImportOPML/ExportOPML touch,
+// restoring them once the calling test finishes, so tests can run in any
+// order without leaking subscriptions into each other.
+func resetFeedState(t *testing.T) {
+	t.Helper()
+	feedMu.Lock()
+	prevFeed, prevSources, prevItems := feed, userSources, userItems
+	feed = nil
+	userSources = make(map[string]*Source)
+	userItems = make(map[string]FeedItems)
+	feedMu.Unlock()
+
+	t.Cleanup(func() {
+		feedMu.Lock()
+		feed, userSources, userItems = prevFeed, prevSources, prevItems
+		feedMu.Unlock()
+	})
+}
+
+const testOPML = `<?xml version="1.0"?>
+<opml version="2.0">
+  <head><title>Test Subscriptions</title></head>
+  <body>
+    <outline text="News">
+      <outline text="Example" title="Example" xmlUrl="http://example.com/feed.xml" htmlUrl="http://example.com"/>
+    </outline>
+    <outline text="Uncategorized Feed" title="Uncategorized Feed" xmlUrl="http://example.org/feed.xml" htmlUrl="http://example.org"/>
+  </body>
+</opml>`
+
+func TestImportOPML(t *testing.T) {
+	resetFeedState(t)
+
+	sources, err := ImportOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatalf("ImportOPML returned error: %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("got %d sources, want 2", len(sources))
+	}
+
+	byURL := make(map[string]*Source, len(sources))
+	for _, s := range sources {
+		byURL[s.FeedUrl] = s
+	}
+
+	grouped, ok := byURL["http://example.com/feed.xml"]
+	if !ok {
+		t.Fatal("missing grouped source")
+	}
+	if grouped.Title != "Example" || grouped.Category != "News" {
+		t.Errorf("unexpected grouped source: %+v", grouped)
+	}
+
+	top, ok := byURL["http://example.org/feed.xml"]
+	if !ok {
+		t.Fatal("missing top-level source")
+	}
+	if top.Title != "Uncategorized Feed" || top.Category != "" {
+		t.Errorf("unexpected top-level source: %+v", top)
+	}
+
+	// every imported source should be registered as a user feed so the
+	// Scheduler picks it up on its next refresh
+	for url := range byURL {
+		if _, exists := snapshotUserSources()[url]; !exists {
+			t.Errorf("ImportOPML did not register %s in userSources", url)
+		}
+	}
+}
+
+func TestImportOPMLSkipsAlreadyRegistered(t *testing.T) {
+	resetFeedState(t)
+
+	if _, err := ImportOPML(strings.NewReader(testOPML)); err != nil {
+		t.Fatalf("first ImportOPML returned error: %v", err)
+	}
+
+	sources, err := ImportOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatalf("second ImportOPML returned error: %v", err)
+	}
+	if len(sources) != 0 {
+		t.Errorf("expected re-importing the same OPML to skip already-registered feeds, got %d sources", len(sources))
+	}
+}
+
+func TestExportOPMLRoundTrip(t *testing.T) {
+	resetFeedState(t)
+
+	if _, err := ImportOPML(strings.NewReader(testOPML)); err != nil {
+		t.Fatalf("ImportOPML returned error: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := ExportOPML(&buf); err != nil {
+		t.Fatalf("ExportOPML returned error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		`xmlUrl="http://example.com/feed.xml"`,
+		`xmlUrl="http://example.org/feed.xml"`,
+		`text="News"`,
+		`text="Subscriptions"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("exported OPML missing %q:\n%s", want, out)
+		}
+	}
+}
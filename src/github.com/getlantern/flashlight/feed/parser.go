@@ -0,0 +1,403 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// feedFormat identifies the on-the-wire syndication format of a
+// user-supplied feed document.
+type feedFormat int
+
+const (
+	formatUnknown feedFormat = iota
+	formatRSS
+	formatAtom
+	formatRDF
+	formatJSONFeed
+)
+
+// sniffLen is how many leading bytes of a feed document we inspect before
+// deciding which concrete parser should handle the rest of the body.
+const sniffLen = 512
+
+// Parser detects and parses an arbitrary RSS 2.0, Atom 1.0, RDF, or JSON
+// Feed document and normalizes it into the same Source/FeedItem shapes
+// doGetFeed builds from the curated feeds.getiantem.org aggregate. This
+// lets end users subscribe to their own sources via AddUserFeed.
+type Parser struct{}
+
+// Parse reads a feed document of unknown format from r, sniffs its format
+// from the first sniffLen bytes, and dispatches to the matching
+// per-format parser. feedURL is recorded on the resulting Source.
+func (p *Parser) Parse(feedURL string, r io.Reader) (*Source, FeedItems, error) {
+	var buf bytes.Buffer
+	tee := io.TeeReader(r, &buf)
+	sniff := make([]byte, sniffLen)
+	n, _ := io.ReadFull(tee, sniff)
+
+	// replay the sniffed bytes ahead of whatever's left unread in r
+	full := io.MultiReader(&buf, r)
+
+	switch sniffFormat(sniff[:n]) {
+	case formatRDF:
+		return parseRDF(feedURL, full)
+	case formatAtom:
+		return parseAtom(feedURL, full)
+	case formatJSONFeed:
+		return parseJSONFeed(feedURL, full)
+	case formatRSS:
+		return parseRSS(feedURL, full)
+	default:
+		return nil, nil, fmt.Errorf("feed: unrecognized format for %s", feedURL)
+	}
+}
+
+// atomTag matches an opening <feed> tag regardless of what attributes
+// (xml:lang, xmlns:media, ...) it carries, or how they're ordered.
+var atomTag = regexp.MustCompile(`<feed[\s>]`)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// sniffFormat looks for format-identifying markers in the first chunk of
+// a feed response. Atom and RDF are checked ahead of the generic <?xml
+// and <rss markers since both of those formats are also XML documents
+// that begin with an <?xml prolog. Atom and JSON Feed are matched on
+// their namespace URI / domain rather than one exact literal tag, since
+// real-world feeds carry extra attributes and whitespace that a literal
+// match would miss.
+func sniffFormat(b []byte) feedFormat {
+	s := strings.TrimSpace(string(b))
+	switch {
+	case strings.HasPrefix(s, "{") && strings.Contains(s, "jsonfeed.org"):
+		return formatJSONFeed
+	case strings.Contains(s, "<rdf:RDF"):
+		return formatRDF
+	case atomTag.MatchString(s) && strings.Contains(s, atomNamespace):
+		return formatAtom
+	case strings.Contains(s, "<rss"), strings.HasPrefix(s, "<?xml"):
+		return formatRSS
+	default:
+		return formatUnknown
+	}
+}
+
+// rssDoc is the minimal subset of RSS 2.0 we normalize into a Source and
+// its FeedItems.
+type rssDoc struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func parseRSS(feedURL string, r io.Reader) (*Source, FeedItems, error) {
+	var doc rssDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("Error parsing RSS feed %s: %v", feedURL, err)
+	}
+	source := &Source{FeedUrl: feedURL, Title: doc.Channel.Title, Url: doc.Channel.Link}
+	items := make(FeedItems, 0, len(doc.Channel.Items))
+	for _, it := range doc.Channel.Items {
+		items = append(items, &FeedItem{
+			Title:   it.Title,
+			Link:    it.Link,
+			Content: strings.TrimSpace(it.Description),
+			Source:  source.Title,
+		})
+	}
+	return source, items, nil
+}
+
+// rdfDoc covers RSS 1.0/RDF feeds, where channel metadata and items are
+// siblings directly under rdf:RDF rather than nested under a <channel>
+// element the way RSS 2.0 items are.
+type rdfDoc struct {
+	XMLName xml.Name `xml:"RDF"`
+	Channel struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+	} `xml:"channel"`
+	Items []struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+	} `xml:"item"`
+}
+
+func parseRDF(feedURL string, r io.Reader) (*Source, FeedItems, error) {
+	var doc rdfDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("Error parsing RDF feed %s: %v", feedURL, err)
+	}
+	source := &Source{FeedUrl: feedURL, Title: doc.Channel.Title, Url: doc.Channel.Link}
+	items := make(FeedItems, 0, len(doc.Items))
+	for _, it := range doc.Items {
+		items = append(items, &FeedItem{
+			Title:   it.Title,
+			Link:    it.Link,
+			Content: strings.TrimSpace(it.Description),
+			Source:  source.Title,
+		})
+	}
+	return source, items, nil
+}
+
+// atomDoc is the minimal subset of Atom 1.0 we normalize into a Source
+// and its FeedItems.
+type atomDoc struct {
+	XMLName xml.Name `xml:"feed"`
+	Title   string   `xml:"title"`
+	Links   []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Entries []struct {
+		Title   string `xml:"title"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+		Links   []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func atomLink(links []struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+func parseAtom(feedURL string, r io.Reader) (*Source, FeedItems, error) {
+	var doc atomDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("Error parsing Atom feed %s: %v", feedURL, err)
+	}
+	source := &Source{FeedUrl: feedURL, Title: doc.Title, Url: atomLink(doc.Links)}
+	items := make(FeedItems, 0, len(doc.Entries))
+	for _, e := range doc.Entries {
+		content := strings.TrimSpace(e.Summary)
+		if content == "" {
+			content = strings.TrimSpace(e.Content)
+		}
+		items = append(items, &FeedItem{
+			Title:   e.Title,
+			Link:    atomLink(e.Links),
+			Content: content,
+			Source:  source.Title,
+		})
+	}
+	return source, items, nil
+}
+
+// jsonFeedDoc is the minimal subset of the JSON Feed spec we normalize
+// into a Source and its FeedItems.
+type jsonFeedDoc struct {
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	Items       []struct {
+		Title       string `json:"title"`
+		URL         string `json:"url"`
+		ContentText string `json:"content_text"`
+		ContentHTML string `json:"content_html"`
+	} `json:"items"`
+}
+
+func parseJSONFeed(feedURL string, r io.Reader) (*Source, FeedItems, error) {
+	var doc jsonFeedDoc
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("Error parsing JSON Feed %s: %v", feedURL, err)
+	}
+	source := &Source{FeedUrl: feedURL, Title: doc.Title, Url: doc.HomePageURL}
+	items := make(FeedItems, 0, len(doc.Items))
+	for _, it := range doc.Items {
+		content := strings.TrimSpace(it.ContentText)
+		if content == "" {
+			content = strings.TrimSpace(it.ContentHTML)
+		}
+		items = append(items, &FeedItem{
+			Title:   it.Title,
+			Link:    it.URL,
+			Content: content,
+			Source:  source.Title,
+		})
+	}
+	return source, items, nil
+}
+
+// userSources holds feeds the end user has added directly via
+// AddUserFeed, kept separate from the curated feeds.getiantem.org
+// aggregate so they survive the next scheduled refresh. The Scheduler
+// walks this map to enqueue a refresh of each one alongside the
+// curated aggregate. userItems caches the most recent items fetched for
+// each, keyed by source title, so reapplyUserFeedsLocked can restore
+// them after the aggregator rebuilds `feed` without a network round
+// trip. Both maps are guarded by feedMu.
+var (
+	userSources = make(map[string]*Source)
+	userItems   = make(map[string]FeedItems)
+)
+
+// AddUserFeed fetches and parses an arbitrary RSS 2.0, Atom 1.0, RDF, or
+// JSON Feed URL supplied by the end user and merges it into the current
+// Feed so its entries show up in the UI alongside the curated Lantern
+// sources. Once added, it's refreshed on the same schedule as the
+// curated aggregate. Like GetFeed, proxyAddr routes the fetch through
+// the tunnel instead of leaking it, which matters for the feeds this
+// user is most likely to add: ones blocked at the origin. allStr is the
+// same "all tab" key GetFeed was given, so this source's entries land in
+// the right feed.Items bucket.
+func AddUserFeed(feedURL string, allStr string, proxyAddr string, provider FeedProvider) error {
+	source, items, err := fetchUserFeed(feedURL, proxyAddr)
+	if err != nil {
+		return err
+	}
+
+	feedMu.Lock()
+	userSources[feedURL] = source
+	mergeUserFeedLocked(source, items, allStr)
+	feedMu.Unlock()
+
+	log.Debugf("Added user feed: %s", source.Title)
+	provider.AddSource(source.Title)
+	return nil
+}
+
+// refreshUserFeed re-fetches a previously added user feed and merges
+// its current entries in, replacing whatever that source contributed
+// last time. It's what the Scheduler calls on each refresh cycle.
+func refreshUserFeed(source *Source, allStr string, proxyAddr string) error {
+	_, items, err := fetchUserFeed(source.FeedUrl, proxyAddr)
+	if err != nil {
+		return err
+	}
+	feedMu.Lock()
+	mergeUserFeedLocked(source, items, allStr)
+	feedMu.Unlock()
+	return nil
+}
+
+func fetchUserFeed(feedURL, proxyAddr string) (*Source, FeedItems, error) {
+	httpClient, err := newHTTPClient(proxyAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error creating client: %v", err)
+	}
+
+	res, err := httpClient.Get(feedURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error fetching user feed %s: %v", feedURL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Error fetching user feed %s: unexpected status %s", feedURL, res.Status)
+	}
+
+	source, items, err := new(Parser).Parse(feedURL, res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source.Title == "" {
+		source.Title = feedURL
+	}
+	return source, items, nil
+}
+
+// mergeUserFeedLocked replaces whatever entries source previously
+// contributed to the in-memory Feed with its current items, after
+// running them through every registered Filter the same way
+// processFeed does for the curated aggregate, so NumFeedEntries and the
+// per-source buckets stay consistent regardless of where an entry came
+// from. It also replaces source's prior contribution to the allStr
+// ("all tab") bucket the same way processFeed populates it, so a
+// user-added feed shows up in the default tab instead of only inflating
+// NumFeedEntries. Callers must hold feedMu.
+func mergeUserFeedLocked(source *Source, items FeedItems, allStr string) {
+	if feed == nil {
+		feed = &Feed{Feeds: make(map[string]*Source), Items: make(map[string]FeedItems)}
+	}
+	if feed.Feeds == nil {
+		feed.Feeds = make(map[string]*Source)
+	}
+	if feed.Items == nil {
+		feed.Items = make(map[string]FeedItems)
+	}
+
+	kept := make(FeedItems, 0, len(items))
+	for _, item := range items {
+		if keepItem(item) {
+			kept = append(kept, item)
+		}
+	}
+
+	pruned := make(FeedItems, 0, len(feed.Entries))
+	for _, entry := range feed.Entries {
+		if entry.Source != source.Title {
+			pruned = append(pruned, entry)
+		}
+	}
+	feed.Entries = append(pruned, kept...)
+
+	prunedAll := make(FeedItems, 0, len(feed.Items[allStr]))
+	for _, entry := range feed.Items[allStr] {
+		if entry.Source != source.Title {
+			prunedAll = append(prunedAll, entry)
+		}
+	}
+	if !source.ExcludeFromAll {
+		prunedAll = append(prunedAll, kept...)
+	}
+	feed.Items[allStr] = prunedAll
+
+	feed.Feeds[source.Title] = source
+	feed.Items[source.Title] = kept
+	// cache the unfiltered items, not `kept`, so a later change to the
+	// registered filters is reflected the next time this source is
+	// reapplied instead of being baked in permanently
+	userItems[source.Title] = items
+}
+
+// reapplyUserFeedsLocked restores every user feed's most recently
+// fetched items into `feed` after the curated aggregator has replaced
+// it wholesale. Callers must hold feedMu.
+func reapplyUserFeedsLocked(allStr string) {
+	for _, source := range userSources {
+		mergeUserFeedLocked(source, userItems[source.Title], allStr)
+	}
+}
+
+// snapshotUserSources returns a point-in-time copy of userSources,
+// keyed by feedURL, that's safe for a caller to range over without
+// holding feedMu itself (e.g. the Scheduler enqueuing a refresh job per
+// source).
+func snapshotUserSources() map[string]*Source {
+	feedMu.Lock()
+	defer feedMu.Unlock()
+	snapshot := make(map[string]*Source, len(userSources))
+	for feedURL, source := range userSources {
+		snapshot[feedURL] = source
+	}
+	return snapshot
+}
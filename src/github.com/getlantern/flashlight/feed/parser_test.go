@@ -0,0 +1,134 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSniffFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want feedFormat
+	}{
+		{
+			name: "rss",
+			body: `<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`,
+			want: formatRSS,
+		},
+		{
+			name: "rdf",
+			body: `<?xml version="1.0"?><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>`,
+			want: formatRDF,
+		},
+		{
+			name: "atom with attributes before the namespace decl",
+			body: `<?xml version="1.0" encoding="utf-8"?><feed xml:lang="en" xmlns="http://www.w3.org/2005/Atom"></feed>`,
+			want: formatAtom,
+		},
+		{
+			name: "atom with newline and extra whitespace between attributes",
+			body: "<?xml version=\"1.0\"?>\n<feed\n  xmlns=\"http://www.w3.org/2005/Atom\">\n</feed>",
+			want: formatAtom,
+		},
+		{
+			name: "json feed",
+			body: `{"version": "https://jsonfeed.org/version/1", "title": "Example", "items": []}`,
+			want: formatJSONFeed,
+		},
+		{
+			name: "unrecognized",
+			body: `not a feed at all`,
+			want: formatUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffFormat([]byte(tt.body)); got != tt.want {
+				t.Errorf("sniffFormat(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRSS(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Example RSS</title>
+    <link>http://example.com</link>
+    <item>
+      <title>First post</title>
+      <link>http://example.com/1</link>
+      <description>  hello  </description>
+    </item>
+  </channel>
+</rss>`
+
+	source, items, err := parseRSS("http://example.com/feed.xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseRSS returned error: %v", err)
+	}
+	if source.Title != "Example RSS" || source.Url != "http://example.com" {
+		t.Errorf("unexpected source: %+v", source)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if items[0].Title != "First post" || items[0].Content != "hello" || items[0].Source != "Example RSS" {
+		t.Errorf("unexpected item: %+v", items[0])
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example Atom</title>
+  <link rel="alternate" href="http://example.com"/>
+  <entry>
+    <title>First entry</title>
+    <link rel="alternate" href="http://example.com/1"/>
+    <summary>a summary</summary>
+  </entry>
+</feed>`
+
+	source, items, err := parseAtom("http://example.com/feed.xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseAtom returned error: %v", err)
+	}
+	if source.Title != "Example Atom" || source.Url != "http://example.com" {
+		t.Errorf("unexpected source: %+v", source)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if items[0].Title != "First entry" || items[0].Link != "http://example.com/1" || items[0].Content != "a summary" {
+		t.Errorf("unexpected item: %+v", items[0])
+	}
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	body := `{
+		"version": "https://jsonfeed.org/version/1",
+		"title": "Example JSON",
+		"home_page_url": "http://example.com",
+		"items": [
+			{"title": "First item", "url": "http://example.com/1", "content_text": "plain text"}
+		]
+	}`
+
+	source, items, err := parseJSONFeed("http://example.com/feed.json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseJSONFeed returned error: %v", err)
+	}
+	if source.Title != "Example JSON" || source.Url != "http://example.com" {
+		t.Errorf("unexpected source: %+v", source)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if items[0].Title != "First item" || items[0].Content != "plain text" {
+		t.Errorf("unexpected item: %+v", items[0])
+	}
+}
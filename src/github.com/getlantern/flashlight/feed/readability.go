@@ -0,0 +1,226 @@
+package feed
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// unlikelyCandidates and positiveHints/negativeHints are the same kind of
+// class/id heuristics used by readability.js and friends: text blocks
+// whose ancestor carries one of these markers are weighted up or down
+// before the highest-scoring block is chosen as "the article".
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|main|shadow`)
+	positiveHints      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negativeHints      = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// Fulldoc fetches the full article at item.Link through the same
+// proxy-aware httpClient GetFeed uses, runs a readability-style
+// extraction over it, and populates FullHTML, Images, WordCount, and
+// LinkCount. It's opt-in and meant to be called per-article (e.g. when
+// the user opens one), so the mobile UI can render it offline without a
+// follow-up round trip to what may be a blocked origin.
+func Fulldoc(item *FeedItem, proxyAddr string) error {
+	httpClient, err := newHTTPClient(proxyAddr)
+	if err != nil {
+		return fmt.Errorf("Error creating client: %v", err)
+	}
+
+	res, err := httpClient.Get(item.Link)
+	if err != nil {
+		return fmt.Errorf("Error fetching article %s: %v", item.Link, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error fetching article %s: unexpected status %s", item.Link, res.Status)
+	}
+
+	base, err := url.Parse(item.Link)
+	if err != nil {
+		return fmt.Errorf("Error parsing article URL %s: %v", item.Link, err)
+	}
+
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		return fmt.Errorf("Error parsing article %s: %v", item.Link, err)
+	}
+
+	article := extractArticle(doc)
+	if article == nil {
+		return fmt.Errorf("Could not extract article content from %s", item.Link)
+	}
+	resolveLinks(article, base)
+
+	item.FullHTML = renderNode(article)
+	item.Images = collectImages(article)
+	item.WordCount = countWords(article)
+	item.LinkCount = countAnchors(article)
+	return nil
+}
+
+// extractArticle scores the parent and grandparent of every <p> holding
+// at least 25 characters of text and returns the node with the highest
+// score, the same "promote the densest block" heuristic
+// readability extractors use to strip boilerplate like navs and footers.
+func extractArticle(doc *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	// candidates preserves the order nodes were first scored in (a <p>'s
+	// parent ahead of its grandparent), so a tie always resolves to
+	// whichever was scored first instead of whatever order map iteration
+	// happens to produce.
+	var candidates []*html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.P {
+			text := strings.TrimSpace(textContent(n))
+			if len(text) >= 25 {
+				if parent := n.Parent; parent != nil {
+					if _, scored := scores[parent]; !scored {
+						candidates = append(candidates, parent)
+					}
+					scores[parent] += paragraphScore(text)
+					if grandparent := parent.Parent; grandparent != nil {
+						if _, scored := scores[grandparent]; !scored {
+							candidates = append(candidates, grandparent)
+						}
+						scores[grandparent] += paragraphScore(text) / 2
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	var bestScore float64
+	for _, n := range candidates {
+		score := scores[n] * classWeight(n)
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+func paragraphScore(text string) float64 {
+	score := 1.0
+	score += float64(strings.Count(text, ","))
+	score += float64(len(text) / 100)
+	return score
+}
+
+// classWeight nudges a candidate's score based on its class/id: markers
+// like "sidebar" or "comment" push it down, markers like "article" or
+// "content" push it up.
+func classWeight(n *html.Node) float64 {
+	weight := 1.0
+	for _, attr := range n.Attr {
+		if attr.Key != "class" && attr.Key != "id" {
+			continue
+		}
+		if unlikelyCandidates.MatchString(attr.Val) && !maybeCandidate.MatchString(attr.Val) {
+			weight -= 0.5
+		}
+		if negativeHints.MatchString(attr.Val) {
+			weight -= 0.25
+		}
+		if positiveHints.MatchString(attr.Val) {
+			weight += 0.25
+		}
+	}
+	if weight < 0.1 {
+		weight = 0.1
+	}
+	return weight
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+		sb.WriteString(" ")
+	}
+	return sb.String()
+}
+
+// resolveLinks rewrites every relative src/href under n to an absolute
+// URL against base, so the extracted HTML can be rendered offline
+// without broken image or link references.
+func resolveLinks(n *html.Node, base *url.URL) {
+	if n.Type == html.ElementNode {
+		for i, attr := range n.Attr {
+			if attr.Key != "src" && attr.Key != "href" {
+				continue
+			}
+			if resolved, err := base.Parse(attr.Val); err == nil {
+				n.Attr[i].Val = resolved.String()
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		resolveLinks(c, base)
+	}
+}
+
+func collectImages(n *html.Node) []string {
+	var images []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			for _, attr := range n.Attr {
+				if attr.Key == "src" && attr.Val != "" {
+					images = append(images, attr.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return images
+}
+
+func countWords(n *html.Node) int {
+	return len(strings.Fields(textContent(n)))
+}
+
+func countAnchors(n *html.Node) int {
+	count := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			count++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return count
+}
+
+func renderNode(n *html.Node) string {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, n); err != nil {
+		log.Debugf("Error rendering extracted article: %v", err)
+	}
+	return buf.String()
+}
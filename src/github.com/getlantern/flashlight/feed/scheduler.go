@@ -0,0 +1,230 @@
+package feed
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultBaseDelay    = 30 * time.Second
+	defaultMaxDelay     = 30 * time.Minute
+	defaultHostInterval = 5 * time.Second
+)
+
+// aggregatorSource tracks success/failure/backoff state for the
+// curated feeds.getiantem.org aggregate across refreshes, the same way
+// a *Source tracks it for a user-added feed.
+var aggregatorSource = &Source{Title: "lantern-aggregate"}
+
+// fetchJob is a single feed fetch to run on the Scheduler's worker
+// pool. source carries the backoff bookkeeping; fetch does the actual
+// work and reports whether it succeeded.
+type fetchJob struct {
+	source *Source
+	host   string
+	fetch  func() error
+	done   *sync.WaitGroup
+}
+
+// Scheduler owns a pool of goroutines that pull fetchJobs off a shared
+// channel. It enforces a minimum interval between requests to the same
+// host and backs a chronically failing source off exponentially so it
+// doesn't starve healthy ones.
+type Scheduler struct {
+	Workers      int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	HostInterval time.Duration
+
+	jobs chan fetchJob
+
+	hostsMu     sync.Mutex
+	lastHostHit map[string]time.Time
+
+	startOnce sync.Once
+
+	// fetchAllMu serializes fetchAll batches. GetFeed and StartTicker's
+	// ticker can both call fetchAll, and without this a ticker tick
+	// firing before the prior batch's WaitGroup drains would enqueue the
+	// same aggregatorSource/user *Source a second time while the first
+	// batch's workers are still mutating its backoff fields.
+	fetchAllMu sync.Mutex
+}
+
+// NewScheduler creates a Scheduler with repo defaults; callers may
+// override its fields before the first Enqueue starts the pool.
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		Workers:      defaultWorkers,
+		BaseDelay:    defaultBaseDelay,
+		MaxDelay:     defaultMaxDelay,
+		HostInterval: defaultHostInterval,
+		jobs:         make(chan fetchJob, 64),
+		lastHostHit:  make(map[string]time.Time),
+	}
+}
+
+// Start launches the worker pool. It's safe to call more than once;
+// only the first call has an effect.
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		for i := 0; i < s.Workers; i++ {
+			go s.worker()
+		}
+	})
+}
+
+// Enqueue schedules a fetch for source, skipping it entirely if it's
+// still within its backoff window. If done is non-nil, it's marked Done
+// once the fetch (or the skip) completes.
+func (s *Scheduler) Enqueue(source *Source, rawurl string, fetch func() error, done *sync.WaitGroup) {
+	s.Start()
+	s.jobs <- fetchJob{source: source, host: hostOf(rawurl), fetch: fetch, done: done}
+}
+
+func (s *Scheduler) worker() {
+	for job := range s.jobs {
+		s.run(job)
+		if job.done != nil {
+			job.done.Done()
+		}
+	}
+}
+
+func (s *Scheduler) run(job fetchJob) {
+	source := job.source
+	if !source.NextAttempt.IsZero() && time.Now().Before(source.NextAttempt) {
+		log.Debugf("Skipping %s, still backed off until %v", source.Title, source.NextAttempt)
+		return
+	}
+
+	s.politeWait(job.host)
+
+	if err := job.fetch(); err != nil {
+		source.Failures++
+		delay := s.BaseDelay * time.Duration(uint64(1)<<uint(min(source.Failures, 10)))
+		if delay > s.MaxDelay {
+			delay = s.MaxDelay
+		}
+		source.NextAttempt = time.Now().Add(delay)
+		log.Debugf("Feed fetch failed for %s (failures=%d, next attempt %v): %v",
+			source.Title, source.Failures, source.NextAttempt, err)
+		return
+	}
+
+	source.Successes++
+	source.Failures = 0
+	source.NextAttempt = time.Time{}
+}
+
+// politeWait blocks, if necessary, until HostInterval has elapsed since
+// the last request to host.
+func (s *Scheduler) politeWait(host string) {
+	if host == "" {
+		return
+	}
+
+	// reserve this request's slot under the lock, so two workers hitting
+	// the same host at once can't both see the same last hit and go out
+	// together
+	s.hostsMu.Lock()
+	now := time.Now()
+	slot := now
+	if last, seen := s.lastHostHit[host]; seen {
+		if next := last.Add(s.HostInterval); next.After(slot) {
+			slot = next
+		}
+	}
+	s.lastHostHit[host] = slot
+	s.hostsMu.Unlock()
+
+	if wait := slot.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// fetchAll enqueues the curated aggregator feed plus every user-added
+// feed and blocks until that batch completes. This is what GetFeed
+// delegates to. Only one batch runs at a time: a manual GetFeed call
+// that lands while a ticker-driven batch is still in flight waits for
+// it to finish rather than enqueueing the same sources a second time.
+func (s *Scheduler) fetchAll(locale, allStr, proxyAddr string, provider FeedProvider) {
+	s.fetchAllMu.Lock()
+	defer s.fetchAllMu.Unlock()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	aggregateURL := getFeedURL(defaultFeedEndpoint, locale)
+	s.Enqueue(aggregatorSource, aggregateURL, func() error {
+		return doGetFeed(defaultFeedEndpoint, locale, allStr, proxyAddr, provider)
+	}, &wg)
+
+	for feedURL, source := range snapshotUserSources() {
+		feedURL, source := feedURL, source
+		wg.Add(1)
+		s.Enqueue(source, feedURL, func() error {
+			return refreshUserFeed(source, allStr, proxyAddr)
+		}, &wg)
+	}
+
+	wg.Wait()
+}
+
+// StartTicker runs the same batch GetFeed does (the curated aggregator
+// plus every user-added feed, through the package Scheduler) on the
+// given interval until stop is called.
+func StartTicker(interval time.Duration, locale, allStr, proxyAddr string, provider FeedProvider) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				defaultScheduler().fetchAll(locale, allStr, proxyAddr, provider)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+var (
+	schedulerMu  sync.Mutex
+	packageSched *Scheduler
+)
+
+// defaultScheduler lazily creates the package-level Scheduler that
+// GetFeed and StartTicker's ticker share.
+func defaultScheduler() *Scheduler {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if packageSched == nil {
+		packageSched = NewScheduler()
+		packageSched.Start()
+	}
+	return packageSched
+}
+
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}